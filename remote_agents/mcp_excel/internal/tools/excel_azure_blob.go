@@ -0,0 +1,411 @@
+package tools
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	z "github.com/Oudwins/zog"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	imcp "github.com/negokaz/excel-mcp-server/internal/mcp"
+)
+
+// azureBlobAPIVersion is the Azure Storage REST API version this client speaks.
+const azureBlobAPIVersion = "2021-08-06"
+
+// azureMSITokenURL is the Azure Instance Metadata Service endpoint used to obtain an
+// access token for the system-assigned managed identity when use_msi is requested.
+const azureMSITokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// azureStorageResource is the AAD resource identifier for Azure Storage, used when
+// requesting an MSI token.
+const azureStorageResource = "https://storage.azure.com/"
+
+type ExcelOpenFromAzureBlobArguments struct {
+	Account    string `zog:"account"`
+	Container  string `zog:"container"`
+	Blob       string `zog:"blob"`
+	Filename   string `zog:"filename"`
+	SasToken   string `zog:"sas_token"`
+	AccountKey string `zog:"account_key"`
+	UseMsi     bool   `zog:"use_msi"`
+}
+
+type ExcelSaveToAzureBlobArguments struct {
+	Path       string `zog:"path"`
+	Account    string `zog:"account"`
+	Container  string `zog:"container"`
+	Blob       string `zog:"blob"`
+	SasToken   string `zog:"sas_token"`
+	AccountKey string `zog:"account_key"`
+	UseMsi     bool   `zog:"use_msi"`
+	IfMatch    string `zog:"if_match"`
+}
+
+var excelOpenFromAzureBlobArgumentsSchema = z.Struct(z.Shape{
+	"account":     z.String().Required(),
+	"container":   z.String().Required(),
+	"blob":        z.String().Required(),
+	"filename":    z.String(),
+	"sas_token":   z.String(),
+	"account_key": z.String(),
+	"use_msi":     z.Bool(),
+})
+
+var excelSaveToAzureBlobArgumentsSchema = z.Struct(z.Shape{
+	"path":        z.String().Required(),
+	"account":     z.String().Required(),
+	"container":   z.String().Required(),
+	"blob":        z.String().Required(),
+	"sas_token":   z.String(),
+	"account_key": z.String(),
+	"use_msi":     z.Bool(),
+	"if_match":    z.String(),
+})
+
+func AddExcelOpenFromAzureBlobTool(server *server.MCPServer) {
+	server.AddTool(mcp.NewTool("excel_open_from_azure_blob",
+		mcp.WithDescription("Download an Excel file directly from Azure Blob Storage using the Blob REST API, authenticating with a SAS token, a storage account key, or the host's managed identity. Use this FIRST when editing a spreadsheet that lives in Azure Blob Storage, then use write/format tools on the returned path."),
+		mcp.WithString("account", mcp.Required(), mcp.Description("Storage account name (e.g. 'mystorageacct')")),
+		mcp.WithString("container", mcp.Required(), mcp.Description("Blob container name")),
+		mcp.WithString("blob", mcp.Required(), mcp.Description("Blob name (path within the container)")),
+		mcp.WithString("filename", mcp.Description("Optional local filename to save as (default: derived from the blob name)")),
+		mcp.WithString("sas_token", mcp.Description("SAS token query string (with or without a leading '?'); mutually exclusive with account_key and use_msi")),
+		mcp.WithString("account_key", mcp.Description("Storage account key, used to sign the request with Shared Key auth; mutually exclusive with sas_token and use_msi")),
+		mcp.WithBoolean("use_msi", mcp.Description("Authenticate as the host's system-assigned managed identity via Azure Instance Metadata Service; mutually exclusive with sas_token and account_key")),
+	), handleOpenFromAzureBlob)
+}
+
+func AddExcelSaveToAzureBlobTool(server *server.MCPServer) {
+	server.AddTool(mcp.NewTool("excel_save_to_azure_blob",
+		mcp.WithDescription("Upload a local Excel file back to Azure Blob Storage using the Blob REST API, authenticating with a SAS token, a storage account key, or the host's managed identity. Use after editing a file downloaded with excel_open_from_azure_blob to write it back, optionally with If-Match concurrency control."),
+		mcp.WithString("path", mcp.Required(), mcp.Description("Local path of the file to upload (e.g. the path returned by excel_open_from_azure_blob)")),
+		mcp.WithString("account", mcp.Required(), mcp.Description("Storage account name (e.g. 'mystorageacct')")),
+		mcp.WithString("container", mcp.Required(), mcp.Description("Blob container name")),
+		mcp.WithString("blob", mcp.Required(), mcp.Description("Blob name (path within the container)")),
+		mcp.WithString("sas_token", mcp.Description("SAS token query string (with or without a leading '?'); mutually exclusive with account_key and use_msi")),
+		mcp.WithString("account_key", mcp.Description("Storage account key, used to sign the request with Shared Key auth; mutually exclusive with sas_token and use_msi")),
+		mcp.WithBoolean("use_msi", mcp.Description("Authenticate as the host's system-assigned managed identity via Azure Instance Metadata Service; mutually exclusive with sas_token and account_key")),
+		mcp.WithString("if_match", mcp.Description("Optional ETag to require the current blob to match, for optimistic-concurrency round-trip edits")),
+	), handleSaveToAzureBlob)
+}
+
+func handleOpenFromAzureBlob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := ExcelOpenFromAzureBlobArguments{}
+	issues := excelOpenFromAzureBlobArgumentsSchema.Parse(request.Params.Arguments, &args)
+	if len(issues) != 0 {
+		return imcp.NewToolResultZogIssueMap(issues), nil
+	}
+
+	auth := azureBlobAuth{SasToken: args.SasToken, AccountKey: args.AccountKey, UseMsi: args.UseMsi}
+	if err := auth.validate(); err != nil {
+		return imcp.NewToolResultInvalidArgumentError(err.Error()), nil
+	}
+
+	storage := NewLocalStorage(downloadRoot)
+	safeName := safeXlsxFilename(args.Filename, args.Blob)
+	localPath, err := storage.Path(safeName)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(err.Error()), nil
+	}
+
+	req, err := newAzureBlobRequest(ctx, http.MethodGet, args.Account, args.Container, args.Blob, auth, nil)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to build request: %v", err)), nil
+	}
+	if auth.AccountKey != "" {
+		if err := signSharedKey(req, args.Account, auth.AccountKey); err != nil {
+			return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to sign request: %v", err)), nil
+		}
+	}
+
+	// Reuse the same retry/cancellation/partial-file-cleanup logic excel_open_from_url
+	// downloads get: the signed headers (Authorization, x-ms-date, x-ms-version) are
+	// computed once above and replayed on every attempt, which Azure accepts within its
+	// clock-skew tolerance for Shared Key requests.
+	spec := downloadSpec{
+		URL:     req.URL.String(),
+		Headers: req.Header,
+		Storage: storage,
+		Name:    safeName,
+	}
+	written, err := downloadToFile(ctx, spec)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to download blob: %v", err)), nil
+	}
+
+	sizeKB := float64(written) / 1024.0
+	text := fmt.Sprintf(
+		"Blob %s/%s downloaded to %s (%.1f KB). Use this path with excel_write_to_sheet, excel_format_range, excel_create_table, etc., then excel_save_to_azure_blob to write it back.",
+		args.Container, args.Blob, localPath, sizeKB,
+	)
+	return mcp.NewToolResultText(text), nil
+}
+
+func handleSaveToAzureBlob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := ExcelSaveToAzureBlobArguments{}
+	issues := excelSaveToAzureBlobArgumentsSchema.Parse(request.Params.Arguments, &args)
+	if len(issues) != 0 {
+		return imcp.NewToolResultZogIssueMap(issues), nil
+	}
+
+	auth := azureBlobAuth{SasToken: args.SasToken, AccountKey: args.AccountKey, UseMsi: args.UseMsi}
+	if err := auth.validate(); err != nil {
+		return imcp.NewToolResultInvalidArgumentError(err.Error()), nil
+	}
+
+	file, err := os.Open(args.Path)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to open local file: %v", err)), nil
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat local file: %w", err)
+	}
+
+	req, err := newAzureBlobRequest(ctx, http.MethodPut, args.Account, args.Container, args.Blob, auth, file)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to build request: %v", err)), nil
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	if args.IfMatch != "" {
+		req.Header.Set("If-Match", args.IfMatch)
+	}
+	if auth.AccountKey != "" {
+		if err := signSharedKey(req, args.Account, auth.AccountKey); err != nil {
+			return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to sign request: %v", err)), nil
+		}
+	}
+
+	resp, err := newDownloadHTTPClient().Do(req)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to upload blob: %v", err)), nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to upload blob: HTTP %d: %s", resp.StatusCode, string(body))), nil
+	}
+
+	text := fmt.Sprintf("Uploaded %s to blob %s/%s (ETag %s).", args.Path, args.Container, args.Blob, resp.Header.Get("ETag"))
+	return mcp.NewToolResultText(text), nil
+}
+
+// azureBlobAuth selects exactly one of the three supported authentication modes for an
+// Azure Blob REST request.
+type azureBlobAuth struct {
+	SasToken   string
+	AccountKey string
+	UseMsi     bool
+}
+
+func (a azureBlobAuth) validate() error {
+	set := 0
+	if a.SasToken != "" {
+		set++
+	}
+	if a.AccountKey != "" {
+		set++
+	}
+	if a.UseMsi {
+		set++
+	}
+	if set == 0 {
+		return fmt.Errorf("one of sas_token, account_key, or use_msi is required")
+	}
+	if set > 1 {
+		return fmt.Errorf("sas_token, account_key, and use_msi are mutually exclusive")
+	}
+	return nil
+}
+
+// newAzureBlobRequest builds (but does not send) a request against the Azure Blob REST
+// API for the given account/container/blob. SAS tokens are appended to the URL and MSI
+// tokens are fetched and set as the Authorization header here; Shared Key signing is
+// applied separately via signSharedKey once the caller has finished setting any
+// method-specific headers (e.g. Content-Length, If-Match), since those headers are part
+// of what gets signed.
+func newAzureBlobRequest(ctx context.Context, method string, account string, container string, blob string, auth azureBlobAuth, body io.Reader) (*http.Request, error) {
+	blobURL := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", account, url.PathEscape(container), escapeBlobPath(blob))
+	if auth.SasToken != "" {
+		sep := "?"
+		if strings.HasPrefix(auth.SasToken, "?") {
+			sep = ""
+		}
+		blobURL += sep + auth.SasToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, blobURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureBlobAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	if auth.UseMsi {
+		token, err := fetchMSIToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch managed identity token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// escapeBlobPath percent-escapes each "/"-separated segment of a blob name, so a name
+// containing a space, "#", "?", or other reserved character is sent as a literal path
+// segment instead of being mis-parsed as a URL fragment/query or a different resource
+// (which would also make the Shared Key signature, computed over the resulting URL's
+// path, no longer match the blob actually requested).
+func escapeBlobPath(blob string) string {
+	segments := strings.Split(blob, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// signSharedKey computes the Azure Storage Shared Key signature for req over its
+// x-ms-* headers and canonicalized resource path, and sets the Authorization header.
+// It must be called after all other headers affecting the signature (Content-Length,
+// If-Match, x-ms-date, etc.) have been set on req.
+func signSharedKey(req *http.Request, account string, accountKey string) error {
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return fmt.Errorf("account_key is not valid base64: %w", err)
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLengthForSigning(req),
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date (we use x-ms-date instead, per the canonicalized headers below)
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedHeaders(req),
+		canonicalizedResource(account, req.URL),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, signature))
+	return nil
+}
+
+// contentLengthForSigning returns the Content-Length to include in the Shared Key
+// string-to-sign, which per the Azure spec is empty (not "0") when there is no body.
+func contentLengthForSigning(req *http.Request) string {
+	if req.ContentLength <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(req.ContentLength, 10)
+}
+
+// canonicalizedHeaders builds the CanonicalizedHeaders component of the Shared Key
+// string-to-sign: all x-ms-* headers, lowercased, sorted, and joined as "name:value".
+func canonicalizedHeaders(req *http.Request) string {
+	var names []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(req.Header.Get(name))
+	}
+	return b.String()
+}
+
+// canonicalizedResource builds the CanonicalizedResource component of the Shared Key
+// string-to-sign: the account-relative path plus any query parameters, sorted by name.
+// It uses u.EscapedPath(), not u.Path, since Azure canonicalizes over the encoded path
+// actually sent on the wire (e.g. produced by escapeBlobPath), not its decoded form.
+func canonicalizedResource(account string, u *url.URL) string {
+	var b strings.Builder
+	b.WriteString("/")
+	b.WriteString(account)
+	b.WriteString(u.EscapedPath())
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString(":")
+		b.WriteString(strings.Join(query[name], ","))
+	}
+	return b.String()
+}
+
+// fetchMSIToken obtains an access token for the host's system-assigned managed identity
+// from the Azure Instance Metadata Service, scoped to the Azure Storage resource.
+func fetchMSIToken(ctx context.Context) (string, error) {
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", azureStorageResource)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureMSITokenURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := newDownloadHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IMDS returned HTTP %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("failed to parse IMDS response: %w", err)
+	}
+	if payload.AccessToken == "" {
+		return "", fmt.Errorf("IMDS response did not contain an access token")
+	}
+	return payload.AccessToken, nil
+}
@@ -2,12 +2,19 @@ package tools
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	z "github.com/Oudwins/zog"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -16,15 +23,68 @@ import (
 )
 
 type ExcelOpenFromURLArguments struct {
-	Url      string `zog:"url"`
-	Filename string `zog:"filename"`
+	Url           string            `zog:"url"`
+	Filename      string            `zog:"filename"`
+	Sha256        string            `zog:"sha256"`
+	DigestUrl     string            `zog:"digest_url"`
+	ProgressToken string            `zog:"progress_token"`
+	Headers       map[string]string `zog:"headers"`
+	BearerToken   string            `zog:"bearer_token"`
 }
 
 var excelOpenFromURLArgumentsSchema = z.Struct(z.Shape{
-	"url":      z.String().Required(),
-	"filename": z.String(),
+	"url":            z.String().Required(),
+	"filename":       z.String(),
+	"sha256":         z.String(),
+	"digest_url":     z.String(),
+	"progress_token": z.String(),
+	"headers":        z.Map(z.String()),
+	"bearer_token":   z.String(),
 })
 
+const (
+	// downloadDialTimeout bounds establishing the TCP connection to the remote host.
+	downloadDialTimeout = 10 * time.Second
+	// downloadRequestTimeout bounds the entire request, including reading the body.
+	downloadRequestTimeout = 5 * time.Minute
+	// downloadMaxAttempts is the number of times a download is attempted before giving up,
+	// including the initial attempt.
+	downloadMaxAttempts = 4
+	// downloadInitialBackoff is the base delay before the first retry (plus random jitter of up
+	// to the same amount); subsequent retries back off exponentially.
+	downloadInitialBackoff = 500 * time.Millisecond
+)
+
+func newDownloadHTTPClient() *http.Client {
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: downloadDialTimeout,
+		}).DialContext,
+	}
+	return &http.Client{
+		Timeout:   downloadRequestTimeout,
+		Transport: transport,
+		// Never let a redirect quietly downgrade a request from HTTPS to HTTP: anything
+		// sent as an Authorization header (bearer token, .netrc Basic auth) would leak to
+		// the plaintext destination. Also drop all request headers on a cross-host
+		// redirect: Go's own Authorization/Cookie stripping doesn't cover the caller's
+		// custom `headers` argument, which could carry an equally sensitive API key.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) == 0 {
+				return nil
+			}
+			prev := via[len(via)-1]
+			if prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing to follow HTTPS->HTTP redirect to %s", req.URL)
+			}
+			if !strings.EqualFold(prev.URL.Host, req.URL.Host) {
+				req.Header = http.Header{}
+			}
+			return nil
+		},
+	}
+}
+
 func AddExcelOpenFromURLTool(server *server.MCPServer) {
 	server.AddTool(mcp.NewTool("excel_open_from_url",
 		mcp.WithDescription("Download an Excel file from a URL (e.g. Azure Blob Storage) to a local path for editing. Use this FIRST when editing an existing spreadsheet from a URL, then use write/format tools on the returned path."),
@@ -35,6 +95,21 @@ func AddExcelOpenFromURLTool(server *server.MCPServer) {
 		mcp.WithString("filename",
 			mcp.Description("Optional local filename to save as (default: derived from URL)"),
 		),
+		mcp.WithString("sha256",
+			mcp.Description("Optional hex-encoded SHA-256 digest the downloaded file must match"),
+		),
+		mcp.WithString("digest_url",
+			mcp.Description("Optional URL to a sha256sum-style digest file to verify the download against (ignored if sha256 is set)"),
+		),
+		mcp.WithString("progress_token",
+			mcp.Description("Optional opaque token to correlate MCP progress notifications emitted for this download"),
+		),
+		mcp.WithObject("headers",
+			mcp.Description("Optional extra HTTP headers to send with the request (e.g. for SharePoint or a corporate proxy); since any header may carry a credential, requires HTTPS"),
+		),
+		mcp.WithString("bearer_token",
+			mcp.Description("Optional token sent as 'Authorization: Bearer <token>'; requires HTTPS"),
+		),
 	), handleOpenFromURL)
 }
 
@@ -51,54 +126,300 @@ func handleOpenFromURL(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 
 	// Determine filename
 	urlPath := strings.SplitN(args.Url, "?", 2)[0]
+	safeName := safeXlsxFilename(args.Filename, filepath.Base(urlPath))
+
+	storage := NewLocalStorage(downloadRoot)
+	localPath, err := storage.Path(safeName)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(err.Error()), nil
+	}
+
+	expectedDigest, err := resolveExpectedDigest(ctx, args)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to resolve expected digest: %v", err)), nil
+	}
+
+	headers, err := resolveRequestHeaders(args.Url, args.Headers, args.BearerToken)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(err.Error()), nil
+	}
+
+	var progressToken mcp.ProgressToken
+	if args.ProgressToken != "" {
+		progressToken = args.ProgressToken
+	}
+
+	spec := downloadSpec{
+		URL:            args.Url,
+		Headers:        headers,
+		Storage:        storage,
+		Name:           safeName,
+		ExpectedDigest: expectedDigest,
+		ProgressToken:  progressToken,
+	}
+	written, err := downloadToFile(ctx, spec)
+	if err != nil {
+		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to download file: %v", err)), nil
+	}
+
+	sizeKB := float64(written) / 1024.0
+	text := fmt.Sprintf(
+		"File downloaded to %s (%.1f KB). Use this path with excel_write_to_sheet, excel_format_range, excel_create_table, etc. The file will be available for download at /download/%s when done.",
+		localPath, sizeKB, filepath.Base(localPath),
+	)
+	return mcp.NewToolResultText(text), nil
+}
+
+// safeXlsxFilename picks the local filename to save a downloaded spreadsheet as: override
+// (e.g. a user-supplied filename) if given, otherwise fallbackBase (typically derived from
+// the source URL or blob name), always ensuring a ".xlsx" extension and stripping any
+// directory components.
+func safeXlsxFilename(override string, fallbackBase string) string {
 	var safeName string
-	if args.Filename != "" {
-		safeName = filepath.Base(args.Filename)
-		if !strings.HasSuffix(safeName, ".xlsx") {
-			safeName += ".xlsx"
-		}
+	if override != "" {
+		safeName = filepath.Base(override)
 	} else {
-		safeName = filepath.Base(urlPath)
+		safeName = filepath.Base(fallbackBase)
 		if safeName == "" || safeName == "." || safeName == "/" {
 			safeName = "spreadsheet.xlsx"
 		}
-		if !strings.HasSuffix(safeName, ".xlsx") {
-			safeName += ".xlsx"
+	}
+	if !strings.HasSuffix(safeName, ".xlsx") {
+		safeName += ".xlsx"
+	}
+	return safeName
+}
+
+// downloadSpec bundles everything a single download needs, since threading each of these
+// through downloadToFile/attemptDownload individually had grown unwieldy. Both
+// excel_open_from_url and excel_open_from_azure_blob build one of these, the latter
+// passing pre-signed request headers (e.g. an Azure Shared Key Authorization header) in
+// place of the caller-supplied ones.
+type downloadSpec struct {
+	URL            string
+	Headers        http.Header
+	Storage        Storage
+	Name           string
+	ExpectedDigest string
+	ProgressToken  mcp.ProgressToken
+}
+
+// downloadToFile fetches spec.URL and streams the response body into spec.Storage under
+// spec.Name, retrying transient failures (5xx responses, connection resets, temporary DNS
+// errors) with exponential backoff. ctx cancellation aborts the in-flight request and any
+// pending retry. On failure, any partially-written file is removed from storage so
+// callers never observe a truncated .xlsx at the returned path. If spec.ExpectedDigest is
+// non-empty, the downloaded bytes are hashed while streamed and the file is rejected (and
+// removed) on mismatch. If spec.ProgressToken is non-nil, MCP progress notifications are
+// emitted for this download as it streams.
+func downloadToFile(ctx context.Context, spec downloadSpec) (int64, error) {
+	client := newDownloadHTTPClient()
+
+	var lastErr error
+	for attempt := 0; attempt < downloadMaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepBackoff(ctx, attempt); err != nil {
+				return 0, lastErr
+			}
+		}
+
+		written, retryable, err := attemptDownload(ctx, client, spec)
+		if err == nil {
+			return written, nil
+		}
+		lastErr = err
+		if !retryable {
+			return 0, err
 		}
 	}
+	return 0, fmt.Errorf("giving up after %d attempts: %w", downloadMaxAttempts, lastErr)
+}
 
-	downloadDir := "/tmp/xlsx_downloads"
-	if err := os.MkdirAll(downloadDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create download directory: %w", err)
+// attemptDownload performs a single download attempt, removing any partially written
+// file from storage before returning an error. The second return value reports whether
+// the error is transient and worth retrying.
+func attemptDownload(ctx context.Context, client *http.Client, spec downloadSpec) (written int64, retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec.URL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	for name, values := range spec.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
 	}
-	localPath := filepath.Join(downloadDir, safeName)
 
-	// Download file
-	resp, err := http.Get(args.Url)
+	resp, err := client.Do(req)
 	if err != nil {
-		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to download file: %v", err)), nil
+		if ctx.Err() != nil {
+			return 0, false, ctx.Err()
+		}
+		return 0, isRetryableRequestError(err), err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return imcp.NewToolResultInvalidArgumentError(fmt.Sprintf("failed to download file: HTTP %d", resp.StatusCode)), nil
+		return 0, isRetryableStatus(resp.StatusCode), fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	outFile, err := spec.Storage.Create(spec.Name)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create local file: %w", err)
+	}
+
+	hasher := sha256.New()
+	body := io.Reader(resp.Body)
+	if spec.ProgressToken != nil {
+		body = newProgressReader(ctx, body, spec.ProgressToken, resp.ContentLength)
+	}
+	if spec.ExpectedDigest != "" {
+		body = io.TeeReader(body, hasher)
+	}
+
+	written, copyErr := io.Copy(outFile, body)
+	closeErr := outFile.Close()
+	if copyErr != nil || closeErr != nil {
+		spec.Storage.Remove(spec.Name)
+		if copyErr != nil {
+			if ctx.Err() != nil {
+				return 0, false, ctx.Err()
+			}
+			return 0, isRetryableRequestError(copyErr), fmt.Errorf("failed to write downloaded file: %w", copyErr)
+		}
+		return 0, false, fmt.Errorf("failed to write downloaded file: %w", closeErr)
+	}
+
+	if spec.ExpectedDigest != "" {
+		if actual := hex.EncodeToString(hasher.Sum(nil)); actual != spec.ExpectedDigest {
+			spec.Storage.Remove(spec.Name)
+			return 0, false, fmt.Errorf("sha256 mismatch: expected %s, got %s", spec.ExpectedDigest, actual)
+		}
 	}
 
-	outFile, err := os.Create(localPath)
+	return written, false, nil
+}
+
+// resolveRequestHeaders builds the headers to send with the download request: custom
+// headers first, then a bearer_token (if set) or else a matching .netrc entry for the
+// URL's host, as HTTP Basic auth. Any caller-supplied header is treated as a potential
+// credential (e.g. a "Cookie" or "X-API-Key" header is just as sensitive as
+// Authorization), so HTTPS is required once any header is present, refusing to send
+// secrets over a plaintext connection.
+func resolveRequestHeaders(rawURL string, custom map[string]string, bearerToken string) (http.Header, error) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create local file: %w", err)
+		return nil, fmt.Errorf("invalid url: %w", err)
 	}
-	defer outFile.Close()
 
-	written, err := io.Copy(outFile, resp.Body)
+	headers := http.Header{}
+	for name, value := range custom {
+		headers.Set(name, value)
+	}
+
+	hasCredential := len(headers) > 0
+	switch {
+	case bearerToken != "":
+		headers.Set("Authorization", "Bearer "+bearerToken)
+		hasCredential = true
+	case headers.Get("Authorization") == "":
+		if user, pass, ok := netrcAuth(u.Hostname()); ok {
+			headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+			hasCredential = true
+		}
+	}
+
+	if hasCredential && !strings.EqualFold(u.Scheme, "https") {
+		return nil, fmt.Errorf("HTTPS is required when headers, bearer_token, or a matching .netrc entry supply credentials")
+	}
+	return headers, nil
+}
+
+// resolveExpectedDigest determines the SHA-256 digest (lowercase hex) the download must
+// match, preferring an explicit sha256 argument over one fetched from digest_url. It
+// returns an empty string when neither is provided, meaning no verification is performed.
+func resolveExpectedDigest(ctx context.Context, args ExcelOpenFromURLArguments) (string, error) {
+	if args.Sha256 != "" {
+		digest := strings.ToLower(strings.TrimSpace(args.Sha256))
+		if len(digest) != sha256.Size*2 {
+			return "", fmt.Errorf("sha256 must be a %d-character hex digest", sha256.Size*2)
+		}
+		return digest, nil
+	}
+	if args.DigestUrl != "" {
+		return fetchDigest(ctx, args.DigestUrl)
+	}
+	return "", nil
+}
+
+// fetchDigest downloads digestUrl and extracts a SHA-256 hex digest from it, accepting
+// either a bare digest or a sha256sum-style line ("<digest>  <filename>").
+func fetchDigest(ctx context.Context, digestUrl string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, digestUrl, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write downloaded file: %w", err)
+		return "", err
 	}
 
-	sizeKB := float64(written) / 1024.0
-	text := fmt.Sprintf(
-		"File downloaded to %s (%.1f KB). Use this path with excel_write_to_sheet, excel_format_range, excel_create_table, etc. The file will be available for download at /download/%s when done.",
-		localPath, sizeKB, safeName,
-	)
-	return mcp.NewToolResultText(text), nil
+	resp, err := newDownloadHTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch digest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch digest: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read digest: %w", err)
+	}
+
+	firstLine := strings.SplitN(strings.TrimSpace(string(body)), "\n", 2)[0]
+	fields := strings.Fields(firstLine)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("digest_url returned an empty digest")
+	}
+	digest := strings.ToLower(fields[0])
+	if len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("digest_url did not contain a valid sha256sum-style digest")
+	}
+	return digest, nil
+}
+
+// isRetryableStatus reports whether an HTTP response status indicates a transient
+// server-side failure worth retrying.
+func isRetryableStatus(status int) bool {
+	return status >= 500 && status <= 599
+}
+
+// isRetryableRequestError reports whether err looks like a transient network failure
+// (connection reset, temporary DNS resolution failure) rather than a permanent one.
+func isRetryableRequestError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return strings.Contains(err.Error(), "connection reset") ||
+		strings.Contains(err.Error(), "EOF")
+}
+
+// sleepBackoff waits the exponential backoff delay for the given retry attempt
+// (1-indexed), returning early with ctx.Err() if ctx is cancelled first.
+func sleepBackoff(ctx context.Context, attempt int) error {
+	delay := downloadInitialBackoff * time.Duration(int64(1)<<uint(attempt-1))
+	// add jitter to avoid thundering-herd retries against the same host
+	delay += time.Duration(rand.Int63n(int64(downloadInitialBackoff)))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// netrcAuth looks up a login/password pair for host in the netrc file pointed to by
+// $NETRC, or ~/.netrc if that's unset, mirroring the lookup cmd/go's internal/auth
+// package performs for module-proxy authentication. ok is false if no netrc file is
+// found, or no "machine" entry matches host and the file has no "default" entry.
+func netrcAuth(host string) (user string, pass string, ok bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+
+	return parseNetrc(f, host)
+}
+
+// parseNetrc scans a netrc-format stream for a "machine <host> login <user> password
+// <pass>" entry matching host. It understands the "machine"/"login"/"password"/"default"
+// tokens; "macdef" macro bodies are not supported and parsing stops there.
+func parseNetrc(r io.Reader, host string) (user string, pass string, ok bool) {
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanWords)
+
+	var machine, login, password string
+	haveMachine := false
+
+	commit := func() {
+		if ok {
+			return
+		}
+		if haveMachine && machine == host {
+			user, pass, ok = login, password, true
+		}
+		machine, login, password, haveMachine = "", "", "", false
+	}
+
+	for sc.Scan() {
+		switch sc.Text() {
+		case "machine":
+			commit()
+			if sc.Scan() {
+				machine = sc.Text()
+				haveMachine = true
+			}
+		case "login":
+			if sc.Scan() {
+				login = sc.Text()
+			}
+		case "password":
+			if sc.Scan() {
+				password = sc.Text()
+			}
+		case "default":
+			commit()
+			haveMachine = true
+			machine = host // a "default" entry always matches
+		case "macdef":
+			commit()
+			return user, pass, ok
+		}
+	}
+	commit()
+	return user, pass, ok
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// progressMinInterval is the time since the last progress notification after which
+	// the next read sends one, so a slow download still reports regularly.
+	progressMinInterval = 500 * time.Millisecond
+	// progressMinBytes is the number of bytes read since the last progress notification
+	// after which the next read sends one, so a fast download reports once per chunk of
+	// this size rather than on every read.
+	progressMinBytes = 256 * 1024
+)
+
+// progressReader wraps an io.Reader, emitting MCP progress notifications to the client
+// that issued progressToken as bytes are read. total is the expected size in bytes (e.g.
+// from the response's Content-Length) and may be zero or negative if unknown, in which case the
+// notification omits its total field. Notifications are throttled to at most once per
+// progressMinBytes read or progressMinInterval elapsed, whichever comes first.
+type progressReader struct {
+	ctx   context.Context
+	inner io.Reader
+	token mcp.ProgressToken
+	total int64
+
+	read         int64
+	unreported   int64
+	lastReportAt time.Time
+}
+
+func newProgressReader(ctx context.Context, inner io.Reader, token mcp.ProgressToken, total int64) *progressReader {
+	return &progressReader{
+		ctx:          ctx,
+		inner:        inner,
+		token:        token,
+		total:        total,
+		lastReportAt: time.Now(),
+	}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.inner.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.unreported += int64(n)
+		if r.unreported >= progressMinBytes || time.Since(r.lastReportAt) >= progressMinInterval {
+			r.report()
+		}
+	}
+	if err == io.EOF {
+		r.report()
+	}
+	return n, err
+}
+
+// report sends a single progress notification for the bytes read so far, if a progress
+// token was supplied and the server can reach the requesting client's session.
+func (r *progressReader) report() {
+	if r.token == nil {
+		return
+	}
+	srv := server.ServerFromContext(r.ctx)
+	if srv == nil {
+		return
+	}
+
+	params := map[string]any{
+		"progressToken": r.token,
+		"progress":      r.read,
+	}
+	if r.total > 0 {
+		params["total"] = r.total
+	}
+	// Best-effort: a failed progress notification shouldn't fail the download.
+	_ = srv.SendNotificationToClient(r.ctx, "notifications/progress", params)
+
+	r.unreported = 0
+	r.lastReportAt = time.Now()
+}
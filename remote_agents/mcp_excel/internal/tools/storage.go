@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// windowsIllegalChars are characters that cannot appear in a filename on Windows, even
+// though downloads commonly run on Linux hosts that would otherwise accept them.
+const windowsIllegalChars = `<>:"|?*`
+
+// downloadRootEnvVar overrides the directory staged downloads are written to.
+const downloadRootEnvVar = "EXCEL_MCP_DOWNLOAD_ROOT"
+
+const defaultDownloadRoot = "/tmp/xlsx_downloads"
+
+var downloadRoot = resolveDownloadRoot()
+
+func resolveDownloadRoot() string {
+	if root := os.Getenv(downloadRootEnvVar); root != "" {
+		return root
+	}
+	return defaultDownloadRoot
+}
+
+// SetDownloadRoot overrides the directory staged downloads are written to, for callers
+// that wire up the MCP server programmatically rather than through EXCEL_MCP_DOWNLOAD_ROOT.
+func SetDownloadRoot(root string) {
+	downloadRoot = root
+}
+
+// sanitizeFilename replaces characters that are illegal in filenames on Windows with '_', so files
+// downloaded on a Linux host stay portable if later moved there.
+func sanitizeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(windowsIllegalChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// safeLocalPath joins name onto root and verifies the result still resides under root,
+// rejecting any "../" or absolute-path escape attempt -- the same defense-in-depth used
+// against zip-slip when extracting archives.
+func safeLocalPath(root string, name string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve download root: %w", err)
+	}
+
+	joined := filepath.Join(absRoot, sanitizeFilename(name))
+	abs, err := filepath.Abs(joined)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if abs != absRoot && !strings.HasPrefix(abs, absRoot+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %q escapes download root %q", name, root)
+	}
+	return abs, nil
+}
+
+// Storage is a pluggable backing store for staged spreadsheet files, letting tools like
+// excel_open_from_url and excel_open_from_azure_blob share the same download/signing
+// logic regardless of where the downloaded bytes end up.
+type Storage interface {
+	// Create opens name for writing, creating any parent directories as needed. The
+	// caller must Close the returned writer.
+	Create(name string) (io.WriteCloser, error)
+	// Remove deletes name, e.g. to clean up a partial download after a failed write.
+	Remove(name string) error
+}
+
+// LocalStorage stores files under a local directory, rejecting names that would escape it.
+type LocalStorage struct {
+	Root string
+}
+
+func NewLocalStorage(root string) LocalStorage {
+	return LocalStorage{Root: root}
+}
+
+func (s LocalStorage) Create(name string) (io.WriteCloser, error) {
+	path, err := s.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	return os.Create(path)
+}
+
+// Path returns the local filesystem path name would be written to, without creating it.
+func (s LocalStorage) Path(name string) (string, error) {
+	return safeLocalPath(s.Root, name)
+}
+
+func (s LocalStorage) Remove(name string) error {
+	path, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}